@@ -0,0 +1,289 @@
+package commandmocker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// Backend selects how Add (and its variants) generate the mocked
+// executable. The zero value, BackendAuto, picks a backend based on
+// runtime.GOOS.
+type Backend int
+
+const (
+	// BackendAuto picks BackendShell on Unix-like systems and BackendBatch
+	// on Windows.
+	BackendAuto Backend = iota
+
+	// BackendShell generates a POSIX "sh" script. This is the default on
+	// Unix-like systems.
+	BackendShell
+
+	// BackendBatch generates a Windows ".cmd" shim. This is the default on
+	// Windows.
+	BackendBatch
+
+	// BackendHelper copies a pre-built commandmocker-helper binary (see
+	// HelperPath) into the tempdir and drives it with a JSON manifest
+	// instead of generating shell code. It works on any platform the
+	// helper binary was built for.
+	BackendHelper
+)
+
+// currentBackend is the Backend used by add when it isn't BackendAuto.
+var currentBackend = BackendAuto
+
+// SetBackend overrides the backend used to generate future mocks. Passing
+// BackendAuto restores the default, GOOS-based selection.
+func SetBackend(b Backend) {
+	currentBackend = b
+}
+
+// resolveBackend turns BackendAuto into a concrete backend for the running
+// platform.
+func resolveBackend() Backend {
+	if currentBackend != BackendAuto {
+		return currentBackend
+	}
+	if runtime.GOOS == "windows" {
+		return BackendBatch
+	}
+	return BackendShell
+}
+
+// HelperPath overrides the location of the pre-built commandmocker-helper
+// binary used by BackendHelper (see cmd/commandmocker-helper). When empty,
+// the binary is looked up on $PATH.
+var HelperPath string
+
+// shellCaptureInvocation is shared by every generated sh script (plain
+// Add mocks and AddScript mocks alike). It records argv, the environment
+// and stdin into temp files and base64-encodes each of them, so arbitrary
+// content - including embedded quotes, newlines or NUL-adjacent "--" args -
+// round-trips through a single JSON-lines record without needing a
+// shell-safe JSON-escaping story. Args and env are NUL-joined before
+// encoding, since argv entries can never themselves contain a NUL byte.
+const shellCaptureInvocation = `argsfile=$(mktemp)
+for i in "$@"
+do
+	printf '%s\0' "$i" >>"$argsfile"
+done
+argsb64=$(base64 <"$argsfile" | tr -d '\n')
+rm -f "$argsfile"
+
+envfile=$(mktemp)
+env | while IFS= read -r line; do printf '%s\0' "$line"; done >"$envfile"
+envb64=$(base64 <"$envfile" | tr -d '\n')
+rm -f "$envfile"
+
+stdinfile=$(mktemp)
+cat >"$stdinfile"
+stdinb64=$(base64 <"$stdinfile" | tr -d '\n')
+startedat=$(date +%s%N)
+`
+
+// shellSource is the POSIX shell script used by BackendShell. It avoids
+// bash-only constructs (process substitution, tee, which, sed) so it also
+// runs under dash and other /bin/sh implementations.
+var shellSource = `#!/bin/sh -e
+
+dirname=$(dirname "$0")
+output=$(cat <<'EOF'
+{{.output}}
+EOF
+)
+erroutput=$(cat <<'EOF'
+{{.erroutput}}
+EOF
+)
+
+` + shellCaptureInvocation + `
+rm -f "$stdinfile"
+printf '{"args":"%s","env":"%s","stdin":"%s","startedAt":%s,"exitCode":%d}\n' "$argsb64" "$envb64" "$stdinb64" "$startedat" {{.status}} >>"${dirname}/.invocations"
+
+printf '%s' "$output" >>"${dirname}/.out"
+printf '%s' "$output"
+printf '%s' "$erroutput" >"${dirname}/.err"
+printf '%s' "$erroutput" 1>&2
+
+exit {{.status}}
+`
+
+// scriptFile returns the file name and contents of the mocked executable
+// for name, using the resolved backend.
+func scriptFile(backend Backend, name, stdout, stderr string, status int) (string, []byte, error) {
+	switch backend {
+	case BackendShell:
+		return shellScriptFile(name, stdout, stderr, status)
+	case BackendBatch:
+		return batchScriptFile(name, stdout, stderr, status)
+	case BackendHelper:
+		return name, nil, nil // handled separately by the helper manifest path
+	default:
+		return "", nil, fmt.Errorf("commandmocker: unknown backend %d", backend)
+	}
+}
+
+func shellScriptFile(name, stdout, stderr string, status int) (string, []byte, error) {
+	t, err := template.New(name).Parse(shellSource)
+	if err != nil {
+		return "", nil, err
+	}
+	param := map[string]interface{}{
+		"output":    stdout,
+		"erroutput": stderr,
+		"status":    status,
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, param); err != nil {
+		return "", nil, err
+	}
+	return name, buf.Bytes(), nil
+}
+
+// batchScriptFile builds a Windows ".cmd" shim. Batch has no heredoc
+// equivalent, so instead of templating the whole file we emit one "echo"
+// per line, appending to the recorded files with ">>" as we go.
+func batchScriptFile(name, stdout, stderr string, status int) (string, []byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("@echo off\r\n")
+	buf.WriteString("setlocal EnableDelayedExpansion\r\n")
+	buf.WriteString("set \"dirname=%~dp0\"\r\n\r\n")
+
+	writeBatchInvocationCapture(&buf)
+	cleanupBatchInvocationCapture(&buf)
+	writeBatchInvocationRecord(&buf, fmt.Sprintf("%d", status))
+
+	buf.WriteString("type nul >\"%dirname%.out\"\r\n")
+	writeBatchLines(&buf, stdout, ".out")
+	buf.WriteString("type \"%dirname%.out\"\r\n\r\n")
+
+	buf.WriteString("type nul >\"%dirname%.err\"\r\n")
+	writeBatchLines(&buf, stderr, ".err")
+	buf.WriteString("type \"%dirname%.err\" 1>&2\r\n\r\n")
+
+	fmt.Fprintf(&buf, "exit /b %d\r\n", status)
+
+	return name + ".cmd", buf.Bytes(), nil
+}
+
+// writeBatchInvocationCapture records argv, env and stdin into !argsb64!,
+// !envb64! and !stdinb64! (plus !startedatms!), ready for
+// writeBatchInvocationRecord to turn into a .invocations line once the
+// exit code is known. Batch has no robust way to NUL-separate or
+// JSON-escape arbitrary strings, so args and env are base64'd via certutil
+// as a whole blob with one entry per CRLF-terminated line (which
+// splitNULB64 accepts in place of NUL separators) - good enough to
+// round-trip the common case, not a byte-exact match for values
+// containing embedded quotes or newlines.
+func writeBatchInvocationCapture(buf *bytes.Buffer) {
+	buf.WriteString("set \"stdinfile=%TEMP%\\commandmocker-stdin-%RANDOM%%RANDOM%.tmp\"\r\n")
+	buf.WriteString("more >\"%stdinfile%\"\r\n")
+	buf.WriteString("set \"argsfile=%TEMP%\\commandmocker-args-%RANDOM%%RANDOM%.tmp\"\r\n")
+	buf.WriteString("(for %%A in (%*) do @echo %%A)>\"%argsfile%\"\r\n")
+	buf.WriteString("set \"envfile=%TEMP%\\commandmocker-env-%RANDOM%%RANDOM%.tmp\"\r\n")
+	buf.WriteString("set >\"%envfile%\"\r\n")
+	buf.WriteString("certutil -f -encode \"%argsfile%\" \"%argsfile%.b64\" >nul\r\n")
+	buf.WriteString("certutil -f -encode \"%envfile%\" \"%envfile%.b64\" >nul\r\n")
+	buf.WriteString("certutil -f -encode \"%stdinfile%\" \"%stdinfile%.b64\" >nul\r\n")
+	buf.WriteString("set \"argsb64=\"\r\n")
+	buf.WriteString("for /f \"usebackq skip=1\" %%L in (\"%argsfile%.b64\") do if not \"%%L\"==\"-----END CERTIFICATE-----\" set \"argsb64=!argsb64!%%L\"\r\n")
+	buf.WriteString("set \"envb64=\"\r\n")
+	buf.WriteString("for /f \"usebackq skip=1\" %%L in (\"%envfile%.b64\") do if not \"%%L\"==\"-----END CERTIFICATE-----\" set \"envb64=!envb64!%%L\"\r\n")
+	buf.WriteString("set \"stdinb64=\"\r\n")
+	buf.WriteString("for /f \"usebackq skip=1\" %%L in (\"%stdinfile%.b64\") do if not \"%%L\"==\"-----END CERTIFICATE-----\" set \"stdinb64=!stdinb64!%%L\"\r\n")
+	buf.WriteString("for /f %%T in ('powershell -NoProfile -Command \"[DateTimeOffset]::UtcNow.ToUnixTimeMilliseconds()\"') do set \"startedatms=%%T\"\r\n")
+	buf.WriteString("del \"%argsfile%\" \"%argsfile%.b64\" \"%envfile%\" \"%envfile%.b64\" \"%stdinfile%.b64\" >nul 2>&1\r\n\r\n")
+}
+
+// cleanupBatchInvocationCapture removes the raw stdin temp file left behind
+// by writeBatchInvocationCapture. It's deliberately not deleted as part of
+// capture itself: an AddScript mock needs the raw (non-base64) file to
+// check StdinContains with "findstr" before the invocation is recorded, so
+// callers call this once they're done matching against it.
+func cleanupBatchInvocationCapture(buf *bytes.Buffer) {
+	buf.WriteString("del \"%stdinfile%\" >nul 2>&1\r\n\r\n")
+}
+
+// writeBatchInvocationRecord appends the .invocations line once the exit
+// code is known; statusExpr is the literal batch text to place in the
+// "exitCode" field (a number for a plain Add mock, a "!status!" variable
+// reference for an AddScript mock).
+func writeBatchInvocationRecord(buf *bytes.Buffer, statusExpr string) {
+	fmt.Fprintf(buf, ">>\"%%dirname%%.invocations\" echo {\"args\":\"!argsb64!\",\"env\":\"!envb64!\",\"stdin\":\"!stdinb64!\",\"startedAt\":!startedatms!000000,\"exitCode\":%s}\r\n\r\n", statusExpr)
+}
+
+// writeBatchLines emits one "echo <line>>>file" command per line of s.
+// Each echoed line ends in CRLF, and an empty line (including the one after
+// a trailing newline in s) is written as "echo.", so the recorded file is
+// not byte-equivalent to what the sh and helper backends write.
+func writeBatchLines(buf *bytes.Buffer, s, file string) {
+	if s == "" {
+		return
+	}
+	for _, line := range strings.Split(s, "\n") {
+		if line == "" {
+			buf.WriteString("echo.>>\"%dirname%" + file + "\"\r\n")
+			continue
+		}
+		fmt.Fprintf(buf, "echo %s>>\"%%dirname%%%s\"\r\n", line, file)
+	}
+}
+
+// helperManifest is serialized next to the copied helper binary and
+// describes the behavior BackendHelper should reproduce.
+type helperManifest struct {
+	Output    string `json:"output"`
+	ErrOutput string `json:"erroutput"`
+	Status    int    `json:"status"`
+}
+
+// copyHelperBinary copies the commandmocker-helper binary (see HelperPath)
+// into tempdir under name (name.exe on Windows) and returns the file name it
+// was written as.
+func copyHelperBinary(tempdir, name string) (string, error) {
+	helperPath := HelperPath
+	if helperPath == "" {
+		found, err := exec.LookPath("commandmocker-helper")
+		if err != nil {
+			return "", fmt.Errorf("commandmocker: BackendHelper requires commandmocker-helper on $PATH or HelperPath set: %w", err)
+		}
+		helperPath = found
+	}
+	bin, err := ioutil.ReadFile(helperPath)
+	if err != nil {
+		return "", err
+	}
+	exeName := name
+	if runtime.GOOS == "windows" {
+		exeName = name + ".exe"
+	}
+	if err := ioutil.WriteFile(path.Join(tempdir, exeName), bin, 0755); err != nil {
+		return "", err
+	}
+	return exeName, nil
+}
+
+// writeHelperMock copies the commandmocker-helper binary into tempdir as
+// name (name.exe on Windows) and writes its JSON manifest alongside it.
+func writeHelperMock(tempdir, name, stdout, stderr string, status int) error {
+	if _, err := copyHelperBinary(tempdir, name); err != nil {
+		return err
+	}
+	manifest, err := json.Marshal(helperManifest{
+		Output:    stdout,
+		ErrOutput: stderr,
+		Status:    status,
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(tempdir, name+".manifest.json"), manifest, 0644)
+}
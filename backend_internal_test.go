@@ -0,0 +1,65 @@
+package commandmocker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// These exercise the BackendBatch code generation directly, asserting on
+// the generated text: the ".cmd" scripts it produces can only actually run
+// on Windows, so there's no way to execute them here.
+
+func TestGlobToFindstrRegex(t *testing.T) {
+	cases := []struct {
+		glob string
+		want string
+	}{
+		{"status", "^status$"},
+		{"rev-*", "^rev-.*$"},
+		{"a?b", "^a.b$"},
+		{"a.b", `^a\.b$`},
+	}
+	for _, c := range cases {
+		if got := globToFindstrRegex(c.glob); got != c.want {
+			t.Errorf("globToFindstrRegex(%q) = %q, want %q", c.glob, got, c.want)
+		}
+	}
+}
+
+func TestWriteBatchLines(t *testing.T) {
+	var buf bytes.Buffer
+	writeBatchLines(&buf, "line one\nline two\n", ".out")
+	got := buf.String()
+	for _, want := range []string{
+		"echo line one>>\"%dirname%.out\"\r\n",
+		"echo line two>>\"%dirname%.out\"\r\n",
+		"echo.>>\"%dirname%.out\"\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("writeBatchLines output missing %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestBatchScriptForRulesMatchesArgsPositionally(t *testing.T) {
+	script := string(batchScriptForRules([]Rule{
+		{ArgsMatch: []string{"log", "--oneline"}, Stdout: "abc\n"},
+	}))
+	if !strings.Contains(script, `findstr /R /C:"^log$"`) {
+		t.Errorf("expected a positional findstr check for the first arg, got:\n%s", script)
+	}
+	if !strings.Contains(script, `findstr /R /C:"^--oneline$"`) {
+		t.Errorf("expected a positional findstr check for the second arg, got:\n%s", script)
+	}
+}
+
+func TestBatchScriptFileWritesRealStderr(t *testing.T) {
+	_, content, err := batchScriptFile("mytool", "out\n", "err text\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "echo err text>>\"%dirname%.err\"") {
+		t.Errorf("expected stderr lines written to .err, got:\n%s", content)
+	}
+}
@@ -0,0 +1,201 @@
+// Command commandmocker-helper is the BackendHelper executable. Add (and
+// AddScript) copy this binary into the mock's tempdir under the mocked
+// command's name and drop a JSON file next to it describing the behavior to
+// reproduce; running the copy emits the same recorded files (.out, .err,
+// .invocations) that the sh backend produces.
+//
+// Two manifest shapes are supported, checked in this order:
+//   - "<name>.rules.json": an AddScript mock, {"rules": [...]}
+//   - "<name>.manifest.json": a plain Add/AddStderr/Error mock
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+type manifest struct {
+	Output    string `json:"output"`
+	ErrOutput string `json:"erroutput"`
+	Status    int    `json:"status"`
+}
+
+type rule struct {
+	ArgsMatch     []string `json:"argsMatch"`
+	Stdout        string   `json:"stdout"`
+	Stderr        string   `json:"stderr"`
+	ExitCode      int      `json:"exitCode"`
+	StdinContains string   `json:"stdinContains"`
+}
+
+type ruleManifest struct {
+	Rules []rule `json:"rules"`
+}
+
+// wireInvocation mirrors the unexported type of the same name in the
+// commandmocker package (see its doc comment for why Args/Env are
+// base64'd rather than embedded as JSON strings directly); Stdin is a
+// plain []byte, which encoding/json already base64-encodes.
+type wireInvocation struct {
+	ArgsB64   string `json:"args"`
+	EnvB64    string `json:"env"`
+	Stdin     []byte `json:"stdin"`
+	StartedAt int64  `json:"startedAt"`
+	ExitCode  int    `json:"exitCode"`
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	startedAt := time.Now()
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	dir := filepath.Dir(exe)
+	name := baseName(exe)
+
+	stdin, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	m, err := resolveManifest(dir, name, os.Args[1:], string(stdin))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// The sh backend captures output with $(cat <<EOF ...), which drops
+	// trailing newlines; do the same so both backends record equal bytes.
+	m.Output = strings.TrimRight(m.Output, "\n")
+	m.ErrOutput = strings.TrimRight(m.ErrOutput, "\n")
+
+	if err := appendFile(filepath.Join(dir, ".out"), m.Output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Print(m.Output)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, ".err"), []byte(m.ErrOutput), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprint(os.Stderr, m.ErrOutput)
+
+	if err := recordInvocation(dir, os.Args[1:], stdin, startedAt, m.Status); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return m.Status
+}
+
+func recordInvocation(dir string, args []string, stdin []byte, startedAt time.Time, status int) error {
+	w := wireInvocation{
+		ArgsB64:   base64.StdEncoding.EncodeToString([]byte(strings.Join(args, "\x00") + "\x00")),
+		EnvB64:    base64.StdEncoding.EncodeToString([]byte(strings.Join(os.Environ(), "\x00") + "\x00")),
+		Stdin:     stdin,
+		StartedAt: startedAt.UnixNano(),
+		ExitCode:  status,
+	}
+	line, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	return appendFile(filepath.Join(dir, ".invocations"), string(line)+"\n")
+}
+
+// resolveManifest picks the rule (AddScript) manifest when present,
+// otherwise falls back to the plain Add/AddStderr/Error manifest.
+func resolveManifest(dir, name string, args []string, stdin string) (manifest, error) {
+	rulesPath := filepath.Join(dir, name+".rules.json")
+	if _, err := os.Stat(rulesPath); err == nil {
+		return resolveRules(rulesPath, args, stdin)
+	}
+	return readManifest(filepath.Join(dir, name+".manifest.json"))
+}
+
+func resolveRules(path string, args []string, stdin string) (manifest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return manifest{}, err
+	}
+	var rm ruleManifest
+	if err := json.Unmarshal(b, &rm); err != nil {
+		return manifest{}, err
+	}
+	for _, r := range rm.Rules {
+		if ruleMatches(r, args, stdin) {
+			return manifest{Output: r.Stdout, ErrOutput: r.Stderr, Status: r.ExitCode}, nil
+		}
+	}
+	return manifest{}, nil
+}
+
+// ruleMatches implements the same matching semantics as the generated
+// shell (shellScriptForRules) and batch (batchScriptForRules) backends:
+// each pattern in ArgsMatch is matched positionally (via filepath.Match, a
+// glob dialect close enough to "case" and "findstr /R" for the two other
+// backends to reproduce) against the invocation's arguments, trailing
+// arguments are ignored, and an empty ArgsMatch matches anything.
+func ruleMatches(r rule, args []string, stdin string) bool {
+	if len(r.ArgsMatch) > len(args) {
+		return false
+	}
+	for i, pattern := range r.ArgsMatch {
+		ok, err := filepath.Match(pattern, args[i])
+		if err != nil || !ok {
+			return false
+		}
+	}
+	if r.StdinContains != "" && !strings.Contains(stdin, r.StdinContains) {
+		return false
+	}
+	return true
+}
+
+// baseName returns the mocked command's name as copyHelperBinary named the
+// copy: the executable's file name, with a trailing ".exe" trimmed on
+// Windows. Unlike filepath.Ext, this leaves any dots that are part of the
+// command's own name (e.g. "python3.9") alone, since those aren't an
+// extension commandmocker added.
+func baseName(exe string) string {
+	name := filepath.Base(exe)
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, ".exe")
+	}
+	return name
+}
+
+func readManifest(path string) (manifest, error) {
+	var m manifest
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+func appendFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(content)
+	return err
+}
+
@@ -0,0 +1,105 @@
+package commandmocker_test
+
+import (
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/thifnmi/mypaas/commandmocker"
+)
+
+// buildHelper compiles cmd/commandmocker-helper into a temp file and returns
+// its path, skipping the test if the go toolchain can't build it here.
+func buildHelper(t *testing.T) string {
+	t.Helper()
+	_, thisFile, _, ok := runtime.Caller(0)
+	if !ok {
+		t.Fatal("could not determine package directory")
+	}
+	bin := filepath.Join(t.TempDir(), "commandmocker-helper")
+	cmd := exec.Command("go", "build", "-o", bin, "./cmd/commandmocker-helper")
+	cmd.Dir = filepath.Dir(thisFile)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("could not build commandmocker-helper: %v: %s", err, out)
+	}
+	return bin
+}
+
+func withHelperBackend(t *testing.T) {
+	t.Helper()
+	commandmocker.HelperPath = buildHelper(t)
+	commandmocker.SetBackend(commandmocker.BackendHelper)
+	t.Cleanup(func() {
+		commandmocker.SetBackend(commandmocker.BackendAuto)
+		commandmocker.HelperPath = ""
+	})
+}
+
+func TestBackendHelperAdd(t *testing.T) {
+	withHelperBackend(t)
+
+	path, err := commandmocker.AddStderr("helper-echo", "out\n", "err\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer commandmocker.Remove(path)
+
+	out, err := exec.Command("helper-echo").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "out" {
+		t.Fatalf("got %q, want %q", out, "out")
+	}
+	if !commandmocker.Ran(path) {
+		t.Fatal("Ran should be true after invocation")
+	}
+}
+
+func TestBackendHelperAddScript(t *testing.T) {
+	withHelperBackend(t)
+
+	path, err := commandmocker.AddScript("helper-git", []commandmocker.Rule{
+		{ArgsMatch: []string{"log", "--oneline"}, Stdout: "abc123 fix\n"},
+		{ArgsMatch: []string{"status"}, Stdout: "clean\n"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer commandmocker.Remove(path)
+
+	if out, err := exec.Command("helper-git", "log", "--oneline").Output(); err != nil {
+		t.Fatal(err)
+	} else if string(out) != "abc123 fix" {
+		t.Fatalf("got %q, want %q", out, "abc123 fix")
+	}
+
+	if out, err := exec.Command("helper-git", "status").Output(); err != nil {
+		t.Fatal(err)
+	} else if string(out) != "clean" {
+		t.Fatalf("got %q, want %q", out, "clean")
+	}
+}
+
+// TestBackendHelperDottedCommandName guards against baseName deriving the
+// manifest/rules file name by stripping everything after the last dot: a
+// command whose own name contains one (e.g. "python3.9") must still resolve
+// its manifest.
+func TestBackendHelperDottedCommandName(t *testing.T) {
+	withHelperBackend(t)
+
+	path, err := commandmocker.Add("python3.9", "hi\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer commandmocker.Remove(path)
+
+	out, err := exec.Command("python3.9").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hi" {
+		t.Fatalf("got %q, want %q", out, "hi")
+	}
+}
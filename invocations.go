@@ -0,0 +1,132 @@
+package commandmocker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Invocation records everything observed about a single call to a mocked
+// executable.
+type Invocation struct {
+	Args      []string
+	Env       []string
+	Stdin     []byte
+	StartedAt time.Time
+	ExitCode  int
+}
+
+// wireInvocation is the on-disk, one-object-per-line shape written to
+// .invocations. Args and Env are stored as base64 of their NUL-joined
+// values (argv entries can't themselves contain NUL; BackendBatch, which
+// can't write NUL, uses CRLF-terminated lines instead) so arbitrary content -
+// including embedded quotes, newlines or "--" - round-trips exactly,
+// without needing a shell-safe JSON-escaping story.
+//
+// .invocations replaces the .params and .envs files the generated mocks
+// used to write directly: those were byte-compatible across backends by
+// construction, but only captured a flattened view (concatenated args,
+// last-call env) with no way to separate calls or capture stdin. This is
+// an intentional break for any caller reading those raw files itself
+// rather than going through Parameters/Envs/Ran - such callers should
+// switch to Invocations.
+type wireInvocation struct {
+	ArgsB64   string `json:"args"`
+	EnvB64    string `json:"env"`
+	Stdin     []byte `json:"stdin"`
+	StartedAt int64  `json:"startedAt"`
+	ExitCode  int    `json:"exitCode"`
+}
+
+// Invocations returns every recorded call to the command mocked in tempdir,
+// oldest first. It returns nil if the mock was never called.
+func Invocations(tempdir string) []Invocation {
+	f, err := os.Open(path.Join(tempdir, ".invocations"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var invocations []Invocation
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var w wireInvocation
+		if err := json.Unmarshal(line, &w); err != nil {
+			continue
+		}
+		invocations = append(invocations, Invocation{
+			Args:      splitNULB64(w.ArgsB64),
+			Env:       splitNULB64(w.EnvB64),
+			Stdin:     w.Stdin,
+			StartedAt: time.Unix(0, w.StartedAt),
+			ExitCode:  w.ExitCode,
+		})
+	}
+	return invocations
+}
+
+// splitNULB64 decodes a base64-encoded, NUL-joined string back into its
+// parts, dropping the trailing empty element left by the terminating NUL.
+// Content with no NUL at all (as written by BackendBatch) is split on CRLF.
+func splitNULB64(s string) []string {
+	if s == "" {
+		return nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	sep := "\x00"
+	if !bytes.Contains(b, []byte{0}) {
+		sep = "\r\n"
+	}
+	parts := strings.Split(string(b), sep)
+	if len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return parts
+}
+
+// Ran indicates whether the mocked executable was called or not.
+func Ran(tempdir string) bool {
+	return len(Invocations(tempdir)) > 0
+}
+
+// Envs returns the environment variables available to the previously added
+// command execution (its last invocation, if it was called more than
+// once).
+func Envs(tempdir string) string {
+	invocations := Invocations(tempdir)
+	if len(invocations) == 0 {
+		return ""
+	}
+	env := invocations[len(invocations)-1].Env
+	if len(env) == 0 {
+		return ""
+	}
+	return strings.Join(env, "\n") + "\n"
+}
+
+// Parameters returns a slice containing all positional parameters given to
+// the command mocked in tempdir, across every invocation. Use Invocations
+// to inspect a specific call instead.
+func Parameters(tempdir string) []string {
+	var params []string
+	for _, inv := range Invocations(tempdir) {
+		params = append(params, inv.Args...)
+	}
+	return params
+}
@@ -0,0 +1,86 @@
+package commandmocker_test
+
+import (
+	"bytes"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/thifnmi/mypaas/commandmocker"
+)
+
+func TestInvocations(t *testing.T) {
+	path, err := commandmocker.Add("invocations-echo", "ok\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer commandmocker.Remove(path)
+
+	if commandmocker.Ran(path) {
+		t.Fatal("Ran should be false before any invocation")
+	}
+
+	firstArgs := []string{"first call", "--", "a b"}
+	if out, err := exec.Command("invocations-echo", firstArgs...).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	secondArgs := []string{"second", "call"}
+	if out, err := exec.Command("invocations-echo", secondArgs...).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	if !commandmocker.Ran(path) {
+		t.Fatal("Ran should be true after invocation")
+	}
+
+	invs := commandmocker.Invocations(path)
+	if len(invs) != 2 {
+		t.Fatalf("expected 2 invocations, got %d", len(invs))
+	}
+	if !reflect.DeepEqual(invs[0].Args, firstArgs) {
+		t.Errorf("invocation 0 args = %#v, want %#v", invs[0].Args, firstArgs)
+	}
+	if !reflect.DeepEqual(invs[1].Args, secondArgs) {
+		t.Errorf("invocation 1 args = %#v, want %#v", invs[1].Args, secondArgs)
+	}
+	if invs[0].StartedAt.After(invs[1].StartedAt) {
+		t.Errorf("invocation 0 (%v) should not start after invocation 1 (%v)", invs[0].StartedAt, invs[1].StartedAt)
+	}
+
+	wantParams := append(append([]string{}, firstArgs...), secondArgs...)
+	if params := commandmocker.Parameters(path); !reflect.DeepEqual(params, wantParams) {
+		t.Errorf("Parameters = %#v, want %#v", params, wantParams)
+	}
+
+	if commandmocker.Envs(path) == "" {
+		t.Error("Envs should be non-empty once the mock has been called")
+	}
+}
+
+// TestInvocationsStdinAndExitCode covers the two Invocation fields
+// TestInvocations doesn't: Stdin and ExitCode.
+func TestInvocationsStdinAndExitCode(t *testing.T) {
+	path, err := commandmocker.Error("invocations-fail", "boom\n", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer commandmocker.Remove(path)
+
+	cmd := exec.Command("invocations-fail")
+	cmd.Stdin = bytes.NewBufferString("piped input\n")
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected a non-zero exit, got none; output: %s", out)
+	}
+
+	invs := commandmocker.Invocations(path)
+	if len(invs) != 1 {
+		t.Fatalf("expected 1 invocation, got %d", len(invs))
+	}
+	if !bytes.Equal(invs[0].Stdin, []byte("piped input\n")) {
+		t.Errorf("Stdin = %q, want %q", invs[0].Stdin, "piped input\n")
+	}
+	if invs[0].ExitCode != 7 {
+		t.Errorf("ExitCode = %d, want 7", invs[0].ExitCode)
+	}
+}
@@ -1,7 +1,6 @@
 package commandmocker
 
 import (
-	"bufio"
 	"crypto/rand"
 	"errors"
 	"fmt"
@@ -10,35 +9,10 @@ import (
 	"path"
 	"strings"
 	"sync"
-	"syscall"
-	"text/template"
+	"testing"
 	"time"
 )
 
-var source = `#!/bin/bash -e
-
-echo=$(which echo)
-output=$(cat <<EOF
-{{.output}}
-EOF
-)
-erroutput=$(cat <<EOF
-{{.erroutput}}
-EOF
-)
-dirname=$(dirname ${0})
-
-$echo -n "${output}" | tee -a ${dirname}/.out
-$echo -n "${erroutput}" >&2 | tee -a ${dirname}/.err
-
-for i in "$@"
-do
-	$echo -- "$i" | sed -e 's/-- //' >> ${dirname}/.params
-done
-touch ${dirname}/.ran
-env >> ${dirname}/.envs
-exit {{.status}}
-`
 var running map[string]string
 var runningMutex sync.RWMutex
 var pathMutex sync.Mutex
@@ -47,7 +21,22 @@ func init() {
 	running = map[string]string{}
 }
 
-func add(name, stdout, stderr string, status int) (string, error) {
+// writeFile writes an executable mock file, truncating anything already
+// there.
+func writeFile(name string, content []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(content)
+	return err
+}
+
+// reserve claims name, creates a fresh tempdir for it and prepends that
+// tempdir to $PATH. Callers are responsible for populating tempdir with the
+// mocked executable.
+func reserve(name string) (string, error) {
 	for {
 		runningMutex.RLock()
 		_, ok := running[name]
@@ -69,33 +58,38 @@ func add(name, stdout, stderr string, status int) (string, error) {
 	}
 	running[name] = tempdir
 	runningMutex.Unlock()
-	err = os.MkdirAll(tempdir, 0777)
-	if err != nil {
+	if err := os.MkdirAll(tempdir, 0777); err != nil {
 		return "", err
 	}
-	f, err := os.OpenFile(path.Join(tempdir, name), syscall.O_WRONLY|syscall.O_CREAT|syscall.O_TRUNC, 0755)
+	pathMutex.Lock()
+	newPath := tempdir + ":" + os.Getenv("PATH")
+	err = os.Setenv("PATH", newPath)
+	pathMutex.Unlock()
 	if err != nil {
 		return "", err
 	}
-	defer f.Close()
-	t, err := template.New(name).Parse(source)
+	return tempdir, nil
+}
+
+func add(name, stdout, stderr string, status int) (string, error) {
+	tempdir, err := reserve(name)
 	if err != nil {
 		return "", err
 	}
-	param := map[string]interface{}{
-		"output":    stdout,
-		"erroutput": stderr,
-		"status":    status,
-	}
-	err = t.Execute(f, param)
-	if err != nil {
-		return "", err
+	backend := resolveBackend()
+	if backend == BackendHelper {
+		if err := writeHelperMock(tempdir, name, stdout, stderr, status); err != nil {
+			return "", err
+		}
+	} else {
+		fileName, content, err := scriptFile(backend, name, stdout, stderr, status)
+		if err != nil {
+			return "", err
+		}
+		if err := writeFile(path.Join(tempdir, fileName), content); err != nil {
+			return "", err
+		}
 	}
-	pathMutex.Lock()
-	path := os.Getenv("PATH")
-	path = tempdir + ":" + path
-	err = os.Setenv("PATH", path)
-	pathMutex.Unlock()
 	return tempdir, nil
 }
 
@@ -122,52 +116,59 @@ func Error(name, output string, status int) (string, error) {
 	return add(name, "", output, status)
 }
 
-// Ran indicates whether the mocked executable was called or not.
-//
-// It just checks if the given tempdir contains a .ran file.
-func Ran(tempdir string) bool {
-	p := path.Join(tempdir, ".ran")
-	_, err := os.Stat(p)
-	return err == nil || !os.IsNotExist(err)
+// AddT works like Add, but it takes a testing.TB instead of returning an
+// error. On failure it calls tb.Fatal, and it registers a cleanup (via
+// tb.Cleanup) that removes the returned tempdir, so callers don't need a
+// matching defer commandmocker.Remove(path) call.
+func AddT(tb testing.TB, name, output string) string {
+	tb.Helper()
+	tempdir, err := Add(name, output)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		Remove(tempdir)
+	})
+	return tempdir
 }
 
-// Output returns the output generated by the previously added command
-// execution.
-func Output(tempdir string) string {
-	p := path.Join(tempdir, ".out")
-	b, err := ioutil.ReadFile(p)
+// AddStderrT works like AddStderr, but it takes a testing.TB instead of
+// returning an error. See AddT for the failure and cleanup behavior.
+func AddStderrT(tb testing.TB, name, stdout, stderr string) string {
+	tb.Helper()
+	tempdir, err := AddStderr(name, stdout, stderr)
 	if err != nil {
-		return ""
+		tb.Fatal(err)
 	}
-	return string(b)
+	tb.Cleanup(func() {
+		Remove(tempdir)
+	})
+	return tempdir
 }
 
-// Envs returns the environment variables available to the previously added
-// command execution.
-func Envs(tempdir string) string {
-	envs := path.Join(tempdir, ".envs")
-	b, err := ioutil.ReadFile(envs)
+// ErrorT works like Error, but it takes a testing.TB instead of returning an
+// error. See AddT for the failure and cleanup behavior.
+func ErrorT(tb testing.TB, name, output string, status int) string {
+	tb.Helper()
+	tempdir, err := Error(name, output, status)
 	if err != nil {
-		return ""
+		tb.Fatal(err)
 	}
-	return string(b)
+	tb.Cleanup(func() {
+		Remove(tempdir)
+	})
+	return tempdir
 }
 
-// Parameters returns a slice containing all positional parameters given to the
-// command mocked in tempdir in its last execution.
-func Parameters(tempdir string) []string {
-	p := path.Join(tempdir, ".params")
-	f, err := os.Open(p)
+// Output returns the output generated by the previously added command
+// execution.
+func Output(tempdir string) string {
+	p := path.Join(tempdir, ".out")
+	b, err := ioutil.ReadFile(p)
 	if err != nil {
-		return nil
-	}
-	defer f.Close()
-	var params []string
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		params = append(params, scanner.Text())
+		return ""
 	}
-	return params
+	return string(b)
 }
 
 // Remove removes the tempdir from $PATH and from file system.
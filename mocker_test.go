@@ -0,0 +1,53 @@
+package commandmocker_test
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/thifnmi/mypaas/commandmocker"
+)
+
+func TestAddTCleanup(t *testing.T) {
+	var tempdir string
+	t.Run("sub", func(t *testing.T) {
+		tempdir = commandmocker.AddT(t, "addt-echo", "hi\n")
+		out, err := exec.Command("addt-echo").CombinedOutput()
+		if err != nil {
+			t.Fatalf("addt-echo: %v: %s", err, out)
+		}
+		if string(out) != "hi" {
+			t.Fatalf("addt-echo: got %q", out)
+		}
+	})
+	if _, err := os.Stat(tempdir); !os.IsNotExist(err) {
+		t.Fatalf("expected tempdir %q to be removed by Cleanup, stat err = %v", tempdir, err)
+	}
+}
+
+func TestAddStderrTCleanup(t *testing.T) {
+	var tempdir string
+	t.Run("sub", func(t *testing.T) {
+		tempdir = commandmocker.AddStderrT(t, "addstderrt-echo", "out\n", "err\n")
+	})
+	if _, err := os.Stat(tempdir); !os.IsNotExist(err) {
+		t.Fatalf("expected tempdir %q to be removed by Cleanup, stat err = %v", tempdir, err)
+	}
+}
+
+func TestErrorTCleanup(t *testing.T) {
+	var tempdir string
+	t.Run("sub", func(t *testing.T) {
+		tempdir = commandmocker.ErrorT(t, "errort-echo", "boom\n", 3)
+		out, err := exec.Command("errort-echo").CombinedOutput()
+		if err == nil {
+			t.Fatal("errort-echo: expected a non-zero exit status")
+		}
+		if string(out) != "boom" {
+			t.Fatalf("errort-echo: got %q", out)
+		}
+	})
+	if _, err := os.Stat(tempdir); !os.IsNotExist(err) {
+		t.Fatalf("expected tempdir %q to be removed by Cleanup, stat err = %v", tempdir, err)
+	}
+}
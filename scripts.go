@@ -0,0 +1,249 @@
+package commandmocker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// Rule describes one conditional response for an AddScript mock. Rules are
+// evaluated in order; the first Rule whose ArgsMatch (and StdinContains, if
+// set) matches the invocation provides the mock's Stdout, Stderr and
+// ExitCode. If no rule matches, the mock exits 0 with no output.
+type Rule struct {
+	// ArgsMatch matches positionally against the invocation's arguments
+	// using shell glob syntax, e.g. "rev-parse" matches an invocation
+	// starting with "rev-parse", regardless of what follows. An empty
+	// ArgsMatch matches any invocation, which is useful as a catch-all
+	// last rule.
+	ArgsMatch []string `json:"argsMatch"`
+
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exitCode"`
+
+	// StdinContains, when non-empty, additionally requires this substring
+	// to appear in the data piped to the mock.
+	StdinContains string `json:"stdinContains"`
+}
+
+// AddScript creates a mock for name whose response depends on how it is
+// called: each invocation is checked against rules in order, and the first
+// matching Rule's Stdout/Stderr/ExitCode is used. This lets a single mock
+// stand in for a command whose behavior must differ across the several
+// calls a test performs (e.g. "git rev-parse" vs "git status") without
+// tearing the mock down and re-adding it between calls.
+func AddScript(name string, rules []Rule) (string, error) {
+	tempdir, err := reserve(name)
+	if err != nil {
+		return "", err
+	}
+	backend := resolveBackend()
+	if backend == BackendHelper {
+		if err := writeHelperScript(tempdir, name, rules); err != nil {
+			return "", err
+		}
+		return tempdir, nil
+	}
+	fileName, content, err := scriptFileForRules(backend, name, rules)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFile(path.Join(tempdir, fileName), content); err != nil {
+		return "", err
+	}
+	return tempdir, nil
+}
+
+func scriptFileForRules(backend Backend, name string, rules []Rule) (string, []byte, error) {
+	switch backend {
+	case BackendShell:
+		return name, shellScriptForRules(rules), nil
+	case BackendBatch:
+		return name + ".cmd", batchScriptForRules(rules), nil
+	default:
+		return "", nil, fmt.Errorf("commandmocker: unknown backend %d", backend)
+	}
+}
+
+// shellSingleQuote wraps s in single quotes, escaping any embedded single
+// quotes, so it can be assigned to a shell variable as a literal value
+// regardless of whitespace or glob metacharacters it contains.
+func shellSingleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellScriptForRules builds a POSIX sh script that walks rules in order:
+// for each one it glob-matches each ArgsMatch entry against the argument at
+// the same position (via "case", mirroring ruleMatches' per-argument
+// filepath.Match in the commandmocker-helper backend), optionally narrowed
+// by a literal StdinContains check, and keeps the first match's
+// output/status. Patterns are assigned to shell variables before use: case
+// patterns are exempt from field splitting, so a variable reference used
+// unquoted stays a single glob pattern no matter what whitespace or glob
+// characters it holds, which plain text spliced into the case arm is not.
+// Each rule gets its own heredoc delimiter so a Stdout/Stderr containing
+// "EOF" can't collide with a neighboring rule.
+func shellScriptForRules(rules []Rule) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#!/bin/sh -e\n\n")
+	buf.WriteString("dirname=$(dirname \"$0\")\n")
+	buf.WriteString(shellCaptureInvocation)
+	buf.WriteString("input=$(cat \"$stdinfile\")\n")
+	buf.WriteString("matched=0\n")
+	buf.WriteString("output=\n")
+	buf.WriteString("erroutput=\n")
+	buf.WriteString("status=0\n\n")
+
+	for i, rule := range rules {
+		delim := fmt.Sprintf("__RULE_%d_EOF__", i)
+		fmt.Fprintf(&buf, "if [ \"$matched\" = 0 ]; then\n")
+		buf.WriteString("\trulematch=1\n")
+		if len(rule.ArgsMatch) > 0 {
+			fmt.Fprintf(&buf, "\tif [ $# -lt %d ]; then rulematch=0; fi\n", len(rule.ArgsMatch))
+			for j, pat := range rule.ArgsMatch {
+				fmt.Fprintf(&buf, "\tpattern_%d_%d=%s\n", i, j, shellSingleQuote(pat))
+				fmt.Fprintf(&buf, "\tif [ \"$rulematch\" = 1 ]; then\n")
+				fmt.Fprintf(&buf, "\t\tcase \"${%d}\" in\n", j+1)
+				fmt.Fprintf(&buf, "\t\t\t$pattern_%d_%d) ;;\n", i, j)
+				buf.WriteString("\t\t\t*) rulematch=0 ;;\n")
+				buf.WriteString("\t\tesac\n")
+				buf.WriteString("\tfi\n")
+			}
+		}
+		if rule.StdinContains != "" {
+			fmt.Fprintf(&buf, "\tstdinsubstr_%d=%s\n", i, shellSingleQuote(rule.StdinContains))
+			buf.WriteString("\tif [ \"$rulematch\" = 1 ]; then\n")
+			buf.WriteString("\t\tcase \"$input\" in\n")
+			fmt.Fprintf(&buf, "\t\t\t*\"$stdinsubstr_%d\"*) ;;\n", i)
+			buf.WriteString("\t\t\t*) rulematch=0 ;;\n")
+			buf.WriteString("\t\tesac\n")
+			buf.WriteString("\tfi\n")
+		}
+		buf.WriteString("\tif [ \"$rulematch\" = 1 ]; then matched=1; fi\n")
+		buf.WriteString("fi\n")
+		fmt.Fprintf(&buf, "if [ \"$matched\" = 1 ] && [ -z \"$output_set\" ]; then\n")
+		buf.WriteString("\toutput_set=1\n")
+		fmt.Fprintf(&buf, "\toutput=$(cat <<'%s'\n%s\n%s\n)\n", delim, rule.Stdout, delim)
+		fmt.Fprintf(&buf, "\terroutput=$(cat <<'%s'\n%s\n%s\n)\n", delim, rule.Stderr, delim)
+		fmt.Fprintf(&buf, "\tstatus=%d\n", rule.ExitCode)
+		buf.WriteString("fi\n\n")
+	}
+
+	buf.WriteString("rm -f \"$stdinfile\"\n")
+	buf.WriteString("printf '{\"args\":\"%s\",\"env\":\"%s\",\"stdin\":\"%s\",\"startedAt\":%s,\"exitCode\":%s}\\n' \"$argsb64\" \"$envb64\" \"$stdinb64\" \"$startedat\" \"$status\" >>\"${dirname}/.invocations\"\n\n")
+
+	buf.WriteString("printf '%s' \"$output\" >>\"${dirname}/.out\"\n")
+	buf.WriteString("printf '%s' \"$output\"\n")
+	buf.WriteString("printf '%s' \"$erroutput\" >\"${dirname}/.err\"\n")
+	buf.WriteString("printf '%s' \"$erroutput\" 1>&2\n\n")
+
+	buf.WriteString("exit \"$status\"\n")
+
+	return buf.Bytes()
+}
+
+// batchScriptForRules is the Windows analogue of shellScriptForRules: it
+// matches ArgsMatch positionally against "%~1", "%~2", ... (batch's own
+// positional parameters, so only the first 9 arguments are matchable) via
+// "findstr /R"
+// against a regex translated from the glob pattern, which mirrors
+// ruleMatches' per-argument filepath.Match. StdinContains is checked as a
+// literal substring (findstr /C:, no regex translation) against the raw
+// stdin file, which is why cleanup of that file is deferred to after the
+// matching loop instead of happening inside invocation capture.
+func batchScriptForRules(rules []Rule) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("@echo off\r\n")
+	buf.WriteString("setlocal EnableDelayedExpansion\r\n")
+	buf.WriteString("set \"dirname=%~dp0\"\r\n")
+	buf.WriteString("set \"matched=\"\r\n\r\n")
+	writeBatchInvocationCapture(&buf)
+
+	for i, rule := range rules {
+		label := fmt.Sprintf("rule%d", i)
+		fmt.Fprintf(&buf, "if not defined matched (\r\n")
+		buf.WriteString("\tset \"rulematch=1\"\r\n")
+		for j, pat := range rule.ArgsMatch {
+			pos := j + 1
+			if pos > 9 {
+				break
+			}
+			regex := globToFindstrRegex(pat)
+			fmt.Fprintf(&buf, "\tif \"%%~%d\"==\"\" set \"rulematch=0\"\r\n", pos)
+			fmt.Fprintf(&buf, "\tif \"!rulematch!\"==\"1\" (echo(%%~%d|findstr /R /C:\"%s\" >nul || set \"rulematch=0\")\r\n", pos, regex)
+		}
+		if rule.StdinContains != "" {
+			fmt.Fprintf(&buf, "\tif \"!rulematch!\"==\"1\" (findstr /C:\"%s\" \"%%stdinfile%%\" >nul || set \"rulematch=0\")\r\n", rule.StdinContains)
+		}
+		fmt.Fprintf(&buf, "\tif \"!rulematch!\"==\"1\" set \"matched=%s\"\r\n", label)
+		buf.WriteString(")\r\n")
+		fmt.Fprintf(&buf, "if \"!matched!\"==\"%s\" if not defined output_set (\r\n", label)
+		buf.WriteString("\tset \"output_set=1\"\r\n")
+		buf.WriteString("\ttype nul >\"%dirname%.out\"\r\n")
+		writeBatchLines(&buf, rule.Stdout, ".out")
+		buf.WriteString("\ttype \"%dirname%.out\"\r\n")
+		buf.WriteString("\ttype nul >\"%dirname%.err\"\r\n")
+		writeBatchLines(&buf, rule.Stderr, ".err")
+		buf.WriteString("\ttype \"%dirname%.err\" 1>&2\r\n")
+		fmt.Fprintf(&buf, "\tset \"status=%d\"\r\n", rule.ExitCode)
+		buf.WriteString(")\r\n\r\n")
+	}
+
+	buf.WriteString("if not defined status set \"status=0\"\r\n\r\n")
+
+	cleanupBatchInvocationCapture(&buf)
+	writeBatchInvocationRecord(&buf, "!status!")
+
+	buf.WriteString("exit /b %status%\r\n")
+
+	return buf.Bytes()
+}
+
+// globToFindstrRegex translates a shell glob (as accepted by filepath.Match
+// and, on Unix, by shellScriptForRules' case patterns) into an anchored
+// "findstr /R" regex: "*" becomes ".*", "?" becomes ".", and regex
+// metacharacters are escaped so they match literally. findstr's regex
+// dialect has no character-class support, so a "[...]" in pat is escaped
+// and matched literally rather than translated.
+func globToFindstrRegex(pat string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pat {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '.', '\\', '^', '$', '[', ']':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// ruleManifest is the JSON shape written next to a copied helper binary for
+// AddScript mocks (BackendHelper).
+type ruleManifest struct {
+	Rules []Rule `json:"rules"`
+}
+
+// writeHelperScript copies the commandmocker-helper binary into tempdir and
+// writes the rules it should evaluate as "<name>.rules.json".
+func writeHelperScript(tempdir, name string, rules []Rule) error {
+	if _, err := copyHelperBinary(tempdir, name); err != nil {
+		return err
+	}
+	manifest, err := json.Marshal(ruleManifest{Rules: rules})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(tempdir, name+".rules.json"), manifest, 0644)
+}
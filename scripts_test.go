@@ -0,0 +1,73 @@
+package commandmocker_test
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+
+	"github.com/thifnmi/mypaas/commandmocker"
+)
+
+func TestAddScript(t *testing.T) {
+	path, err := commandmocker.AddScript("git", []commandmocker.Rule{
+		{ArgsMatch: []string{"log", "--oneline"}, Stdout: "abc123 fix\n"},
+		{ArgsMatch: []string{"status"}, Stdout: "clean\n"},
+		{ArgsMatch: []string{"rev-parse"}, Stdout: "deadbeef\n"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer commandmocker.Remove(path)
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"log", "--oneline"}, "abc123 fix"},
+		{[]string{"status"}, "clean"},
+		{[]string{"rev-parse"}, "deadbeef"},
+		// Must not be caught by the "rev-parse" rule: ArgsMatch is matched
+		// positionally per-argument, not as a prefix of the joined argv.
+		{[]string{"rev-parse-else"}, ""},
+	}
+	for _, c := range cases {
+		out, err := exec.Command("git", c.args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", c.args, err, out)
+		}
+		if string(out) != c.want {
+			t.Errorf("git %v: got %q, want %q", c.args, out, c.want)
+		}
+	}
+}
+
+func TestAddScriptStdinContains(t *testing.T) {
+	path, err := commandmocker.AddScript("mocked-reader", []commandmocker.Rule{
+		{StdinContains: "hello world", Stdout: "matched\n"},
+		{Stdout: "nomatch\n"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer commandmocker.Remove(path)
+
+	cmd := exec.Command("mocked-reader")
+	cmd.Stdin = bytes.NewBufferString("say hello world ok")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if string(out) != "matched" {
+		t.Fatalf("got %q, want %q", out, "matched")
+	}
+
+	cmd = exec.Command("mocked-reader")
+	cmd.Stdin = bytes.NewBufferString("nothing interesting")
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if string(out) != "nomatch" {
+		t.Fatalf("got %q, want %q", out, "nomatch")
+	}
+}